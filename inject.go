@@ -2,8 +2,12 @@
 package inject
 
 import (
+	"context"
 	"fmt"
 	"reflect"
+	"runtime"
+	"strings"
+	"sync"
 )
 
 // Injector represents an interface for mapping and injecting dependencies into structs
@@ -16,6 +20,66 @@ type Injector interface {
 	// dependency in its Type map it will check its parent before returning an
 	// error.
 	SetParent(Injector)
+	// Dispose calls Dispose, in LIFO order, on every Disposer value this
+	// injector itself constructed via MapSingleton. It does not dispose
+	// values inherited from a parent injector, since those belong to
+	// whichever injector mapped them.
+	Dispose()
+	// Validate walks every provider mapped on this injector (and its
+	// parents), including named bindings, reporting the first circular
+	// provider chain or unsatisfiable provider argument it finds. It catches
+	// at startup what would otherwise be an infinite recursion or a runtime
+	// error at Get time.
+	Validate() error
+	// ValidateFor is like Validate, but additionally checks fn's own
+	// argument types, as Invoke would resolve them. Call it before running a
+	// handler to turn a missing dependency or provider cycle into a
+	// startup-time error instead of an Invoke-time one.
+	ValidateFor(fn interface{}) error
+}
+
+// DependencyError reports why Injector.Validate or Injector.ValidateFor
+// failed: either a circular provider chain or a provider argument that
+// nothing mapped can satisfy.
+type DependencyError struct {
+	// Func names the function whose argument couldn't be resolved: either
+	// the function passed to ValidateFor, or the provider whose own
+	// argument triggered the failure.
+	Func string
+	// Cycle lists the types forming a circular provider chain, in
+	// traversal order, ending with the type that closes the cycle. Nil
+	// unless the failure is a cycle.
+	Cycle []reflect.Type
+	// Missing is the argument type that nothing mapped could satisfy. Nil
+	// unless the failure is an unsatisfiable dependency.
+	Missing reflect.Type
+}
+
+func (e *DependencyError) Error() string {
+	if e.Cycle != nil {
+		names := make([]string, len(e.Cycle))
+		for i, t := range e.Cycle {
+			names[i] = t.String()
+		}
+		return fmt.Sprintf("inject: %s has a circular provider dependency: %s", e.Func, strings.Join(names, " -> "))
+	}
+	return fmt.Sprintf("inject: %s requires %v, which is not mapped", e.Func, e.Missing)
+}
+
+// Initializer is an optional interface recognized by Apply and by
+// MapSingleton-backed values. A value that implements it has Initialize
+// called immediately after it is constructed (for a singleton provider's
+// outputs, the first time they're used) or injected (for an Apply'd struct
+// field), with the injector responsible for that construction/injection.
+type Initializer interface {
+	Initialize(Injector) error
+}
+
+// Disposer is an optional interface recognized by MapSingleton. A value
+// that implements it is tracked by the injector that mapped its provider
+// and released, in LIFO order, by that injector's Dispose method.
+type Disposer interface {
+	Dispose()
 }
 
 // Applicator represents an interface for mapping dependencies to a struct.
@@ -33,6 +97,69 @@ type Invoker interface {
 	// a slice of reflect.Value representing the returned values of the function.
 	// Returns an error if the injection fails.
 	Invoke(interface{}) ([]reflect.Value, error)
+	// Plan resolves fn's argument types once against the current type map
+	// (and parent chain) and returns a Plan that can be called repeatedly
+	// without repeating that resolution. Returns an error if a
+	// non-context.Context argument cannot be satisfied. It panics if fn is
+	// not a function.
+	//
+	// Plan is an optimization for hot paths that call the same function
+	// many times (e.g. an HTTP handler called per request): it trades the
+	// flexibility of re-resolving every argument on every call for the
+	// speed of doing so once, up front.
+	Plan(fn interface{}) (Plan, error)
+	// InvokeChain runs chain's providers in order, feeding each provider's
+	// return values to later providers in the chain, and finally to
+	// terminal, whose return values are returned. Returns an error if any
+	// provider's or terminal's dependencies cannot be satisfied.
+	//
+	// See Sequence for how to build a Chain, including middleware-style
+	// wrap/next providers.
+	InvokeChain(chain Chain, terminal interface{}) ([]reflect.Value, error)
+}
+
+// Plan is a precompiled invocation produced by Invoker.Plan. It caches the
+// argument resolution Invoke otherwise repeats on every call: literal
+// values are fetched once, at Plan time.
+//
+// Provider-backed arguments are still re-evaluated on every call, per the
+// non-caching semantics documented on TypeMapper.MapProvider.
+type Plan interface {
+	// Call invokes the planned function and returns its return values.
+	Call() ([]reflect.Value, error)
+	// CallContext is like Call, but supplies ctx directly for any planned
+	// argument of type context.Context, instead of resolving it from the
+	// type map. This lets a plan be reused across requests without mapping
+	// or providing a new context.Context each time.
+	CallContext(ctx context.Context) ([]reflect.Value, error)
+}
+
+// Chain is a static sequence of providers assembled by Sequence, to be run
+// by Injector.InvokeChain.
+type Chain struct {
+	providers []interface{}
+}
+
+// Sequence assembles providers into a Chain for InvokeChain. Each
+// provider's return values become available as arguments to providers (and
+// the terminal function) later in the chain, in addition to whatever is
+// already mapped on the injector.
+//
+// A provider may also declare a func() or func() error as its first
+// argument: InvokeChain then treats it as a wrapper and calls it with a
+// function that runs the remainder of the chain, letting the provider run
+// code both before and after the rest of the chain executes (e.g. logging
+// or transaction middleware). A func()-style next panics if the rest of
+// the chain fails, matching the panic-on-failure convention providers
+// already follow (see TypeMapper.MapProvider); a func() error-style next
+// returns the failure instead, for wrappers that want to handle it.
+//
+// InvokeChain determines, before calling anything, which non-wrapper
+// providers are actually needed to satisfy the terminal function (and any
+// wrappers) and skips the rest; wrapper providers always run, since their
+// purpose is the wrapping rather than their return values.
+func Sequence(providers ...interface{}) Chain {
+	return Chain{providers: providers}
 }
 
 // TypeMapper represents an interface for mapping interface{} values based on type.
@@ -61,6 +188,23 @@ type TypeMapper interface {
 	// Attempting to retrieve either type A or B from the mapper will result in
 	// an infinite loop.
 	MapProvider(interface{}) TypeMapper
+	// Maps the interface{} function like MapProvider, except its outputs are
+	// memoized the first time any of them is requested from this injector,
+	// instead of being recomputed on every call. If an output implements
+	// Initializer, Initialize is called once, right after construction; if
+	// it implements Disposer, it is released by this injector's Dispose.
+	MapSingleton(provider interface{}) TypeMapper
+	// Maps the interface{} value based on its immediate type from reflect.TypeOf,
+	// qualified by name. This allows several values of the same type to be
+	// mapped side by side, distinguished by the name passed to GetNamed or an
+	// `inject:"name"` struct tag.
+	MapNamed(name string, val interface{}) TypeMapper
+	// Maps the interface{} value based on the pointer of an Interface provided,
+	// qualified by name. See MapTo and MapNamed.
+	MapNamedTo(name string, val interface{}, ifacePtr interface{}) TypeMapper
+	// Maps the interface{} function as a provider of its return types, qualified
+	// by name. See MapProvider and MapNamed.
+	MapNamedProvider(name string, provider interface{}) TypeMapper
 	// Provides a possibility to directly insert a mapping based on type and value.
 	// This makes it possible to directly map type arguments not possible to instantiate
 	// with reflect like unidirectional channels.
@@ -72,6 +216,11 @@ type TypeMapper interface {
 	// behaviour. These options may not necessarily be user-facing, and the
 	// function may panic if provided unrecognized/inappropriate options.
 	Get(t reflect.Type, options ...interface{}) reflect.Value
+	// Returns the Value that is mapped to the current type under name. Returns
+	// a zeroed Value if no value has been mapped for that type/name pair.
+	// Unlike Get, a named lookup never falls back to a value mapped without a
+	// name; an empty name simply addresses its own (likely empty) namespace.
+	GetNamed(name string, t reflect.Type, options ...interface{}) reflect.Value
 }
 
 // mappedValue is a value which can be injected via TypeMapper.Get. It may be a
@@ -103,14 +252,84 @@ func (v providedValue) Get(i Injector) reflect.Value {
 		panic(err)
 	}
 	// The index of the type-appropriate return has been populated by
-	// TypeMapper.MapProvider, and interface-appropriateness checking has been
-	// done by TypeMapper.Get. We can just blindly return the right value.
+	// TypeMapper.MapProvider (or TypeMapper.MapNamedProvider), and
+	// interface-appropriateness checking has been done by TypeMapper.Get. We
+	// can just blindly return the right value.
 	return values[v.outIndex]
 }
 
+// singletonGroup memoizes the outputs of a MapSingleton provider: the
+// provider runs at most once per injector, the first time any of its
+// outputs is requested.
+type singletonGroup struct {
+	owner    *injector
+	provider interface{}
+	once     sync.Once
+	values   []reflect.Value
+}
+
+// ensure runs the provider the first time it's called, resolving its
+// arguments via i (the injector application code originally called Get on),
+// then runs Initializer/Disposer hooks on its outputs. Later calls reuse the
+// cached values and do nothing.
+func (g *singletonGroup) ensure(i Injector) {
+	g.once.Do(func() {
+		values, err := i.Invoke(g.provider)
+		if err != nil {
+			panic(err)
+		}
+		g.values = values
+
+		for _, v := range values {
+			if !v.IsValid() || !v.CanInterface() {
+				continue
+			}
+			iface := v.Interface()
+			if init, ok := iface.(Initializer); ok {
+				if err := init.Initialize(i); err != nil {
+					panic(err)
+				}
+			}
+			if d, ok := iface.(Disposer); ok {
+				g.owner.disposersMu.Lock()
+				g.owner.disposers = append(g.owner.disposers, d)
+				g.owner.disposersMu.Unlock()
+			}
+		}
+	})
+}
+
+// singletonValue is one output slot of a MapSingleton provider.
+type singletonValue struct {
+	group    *singletonGroup
+	outIndex int
+}
+
+// Get the value, constructing the whole group of outputs on first use.
+func (v singletonValue) Get(i Injector) reflect.Value {
+	v.group.ensure(i)
+	return v.group.values[v.outIndex]
+}
+
+// namedKey identifies a value mapped under both a concrete type and a
+// qualifier name, so that multiple values of the same type can be mapped
+// side by side (see TypeMapper.MapNamed and TypeMapper.GetNamed).
+type namedKey struct {
+	t    reflect.Type
+	name string
+}
+
 type injector struct {
-	values map[reflect.Type]mappedValue
-	parent Injector
+	values      map[reflect.Type]mappedValue
+	namedValues map[namedKey]mappedValue
+	parent      Injector
+	// disposersMu guards disposers, since distinct singletonGroups owned by
+	// the same injector can be ensure()d concurrently from separate
+	// goroutines (each group's own sync.Once only serializes that group).
+	disposersMu sync.Mutex
+	// disposers holds the Disposer values constructed by this injector's own
+	// MapSingleton providers, in construction order, for Dispose.
+	disposers []Disposer
 }
 
 // InterfaceOf dereferences a pointer to an Interface type.
@@ -132,7 +351,8 @@ func InterfaceOf(value interface{}) reflect.Type {
 // New returns a new Injector.
 func New() Injector {
 	return &injector{
-		values: make(map[reflect.Type]mappedValue),
+		values:      make(map[reflect.Type]mappedValue),
+		namedValues: make(map[namedKey]mappedValue),
 	}
 }
 
@@ -158,6 +378,602 @@ func (inj *injector) Invoke(f interface{}) ([]reflect.Value, error) {
 	return reflect.ValueOf(f).Call(in), nil
 }
 
+// contextType is the reflect.Type of context.Context, used by Plan/CallContext
+// to recognize an argument that CallContext may supply directly.
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// planSlot is one resolved argument slot of a Plan.
+type planSlot struct {
+	argType reflect.Type
+	// cached holds the argument value if it was resolved to a literalValue
+	// at Plan time. Literal mappings never change, so there is no need to
+	// look them up again on every call.
+	cached reflect.Value
+	// dynamic holds the mappedValue to re-resolve on every call, for
+	// provider-backed slots, which TypeMapper.MapProvider documents as
+	// never cached.
+	dynamic mappedValue
+}
+
+// plan is the concrete implementation of Plan returned by injector.Plan.
+type plan struct {
+	injector Injector
+	fn       reflect.Value
+	slots    []planSlot
+}
+
+// resolve finds the mappedValue bound to t without invoking it, walking the
+// parent chain and scanning for interface implementors exactly as Get does.
+func (inj *injector) resolve(t reflect.Type) (mappedValue, bool) {
+	if val, ok := inj.values[t]; ok {
+		return val, true
+	}
+
+	if t.Kind() == reflect.Interface {
+		for k, v := range inj.values {
+			if k.Implements(t) {
+				return v, true
+			}
+		}
+	}
+
+	if inj.parent != nil {
+		if p, ok := inj.parent.(*injector); ok {
+			return p.resolve(t)
+		}
+	}
+
+	return nil, false
+}
+
+// resolveNamed finds the mappedValue bound to t under name, without
+// invoking it, walking the parent chain exactly as GetNamed does.
+func (inj *injector) resolveNamed(name string, t reflect.Type) (mappedValue, bool) {
+	if val, ok := inj.namedValues[namedKey{t, name}]; ok {
+		return val, true
+	}
+
+	if t.Kind() == reflect.Interface {
+		for k, v := range inj.namedValues {
+			if k.name == name && k.t.Implements(t) {
+				return v, true
+			}
+		}
+	}
+
+	if inj.parent != nil {
+		if p, ok := inj.parent.(*injector); ok {
+			return p.resolveNamed(name, t)
+		}
+	}
+
+	return nil, false
+}
+
+// lookupMapped finds the mappedValue Apply would have used to resolve a
+// struct field of type t (tagged with name, or untagged if name is empty),
+// without invoking it.
+func (inj *injector) lookupMapped(name string, t reflect.Type) (mappedValue, bool) {
+	if name != "" {
+		return inj.resolveNamed(name, t)
+	}
+	return inj.resolve(t)
+}
+
+// depColor is a DFS node color used by validateType to detect cycles with
+// the standard white/gray/black algorithm: white is unvisited, gray is on
+// the current path (still being explored), black is fully explored and
+// known dependency-satisfiable.
+type depColor int
+
+const (
+	white depColor = iota
+	gray
+	black
+)
+
+// providerOf returns the provider function behind a provider-backed
+// mappedValue, so its own argument types can be walked. literalValue has no
+// provider and no further dependencies.
+func providerOf(mv mappedValue) (interface{}, bool) {
+	switch v := mv.(type) {
+	case providedValue:
+		return v.provider, true
+	case singletonValue:
+		return v.group.provider, true
+	default:
+		return nil, false
+	}
+}
+
+// funcName returns fn's name via runtime.FuncForPC, for use in a
+// DependencyError, falling back to fn's type string if that's unavailable
+// (e.g. for a nil function value).
+func funcName(fn interface{}) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() == reflect.Func {
+		if pc := v.Pointer(); pc != 0 {
+			if rf := runtime.FuncForPC(pc); rf != nil {
+				return rf.Name()
+			}
+		}
+	}
+	return v.Type().String()
+}
+
+// validationNode identifies one (injector, type) pair visited during a
+// Validate/ValidateFor walk. Keying colors by the resolving injector, not
+// just the type, keeps the walk of one injector's mappings from marking a
+// same-typed but differently-provided node black on another injector in
+// the parent chain.
+type validationNode struct {
+	owner *injector
+	t     reflect.Type
+	// name is the binding name for a node reached through a named mapping
+	// (MapNamed, MapNamedTo, MapNamedProvider), or "" for a plain, unnamed
+	// one. It keeps a type's named and unnamed nodes from colliding in the
+	// same colors map, since GetNamed and Get resolve from separate maps.
+	name string
+}
+
+// validateType DFS-visits t, and everything its provider (if any) depends
+// on, looking for a circular provider chain or an unsatisfiable dependency.
+// colors tracks node state across the whole walk a Validate/ValidateFor
+// call makes; path is the chain of types on the current DFS branch, used to
+// report the offending cycle. requiredBy names whichever function needs t:
+// the function passed to ValidateFor, or the provider that declared t as
+// one of its own arguments.
+func (inj *injector) validateType(t reflect.Type, colors map[validationNode]depColor, path []reflect.Type, requiredBy string) error {
+	node := validationNode{owner: inj, t: t}
+	switch colors[node] {
+	case black:
+		return nil
+	case gray:
+		start := 0
+		for i, seen := range path {
+			if seen == t {
+				start = i
+				break
+			}
+		}
+		cycle := append(append([]reflect.Type{}, path[start:]...), t)
+		return &DependencyError{Func: requiredBy, Cycle: cycle}
+	}
+
+	mv, ok := inj.resolve(t)
+	if !ok {
+		return &DependencyError{Func: requiredBy, Missing: t}
+	}
+
+	colors[node] = gray
+	path = append(path, t)
+
+	if provider, ok := providerOf(mv); ok {
+		providerType := reflect.TypeOf(provider)
+		providerName := funcName(provider)
+		for i := 0; i < providerType.NumIn(); i++ {
+			if err := inj.validateType(providerType.In(i), colors, path, providerName); err != nil {
+				return err
+			}
+		}
+	}
+
+	colors[node] = black
+	return nil
+}
+
+// validateNamedType is the named analog of validateType: it DFS-visits the
+// (t, name) binding, and everything its provider (if any) depends on. A
+// named provider's own arguments are still resolved, and so walked, through
+// the plain type map via validateType: a provider function has no way to
+// declare that one of its own arguments should come from a named binding
+// rather than an unnamed one (see TypeMapper.GetNamed), so that's the only
+// resolution Invoke will ever actually perform for it.
+func (inj *injector) validateNamedType(t reflect.Type, name string, colors map[validationNode]depColor, path []reflect.Type, requiredBy string) error {
+	node := validationNode{owner: inj, t: t, name: name}
+	switch colors[node] {
+	case black:
+		return nil
+	case gray:
+		start := 0
+		for i, seen := range path {
+			if seen == t {
+				start = i
+				break
+			}
+		}
+		cycle := append(append([]reflect.Type{}, path[start:]...), t)
+		return &DependencyError{Func: requiredBy, Cycle: cycle}
+	}
+
+	mv, ok := inj.resolveNamed(name, t)
+	if !ok {
+		return &DependencyError{Func: requiredBy, Missing: t}
+	}
+
+	colors[node] = gray
+	path = append(path, t)
+
+	if provider, ok := providerOf(mv); ok {
+		providerType := reflect.TypeOf(provider)
+		providerName := funcName(provider)
+		for i := 0; i < providerType.NumIn(); i++ {
+			if err := inj.validateType(providerType.In(i), colors, path, providerName); err != nil {
+				return err
+			}
+		}
+	}
+
+	colors[node] = black
+	return nil
+}
+
+// validateNamedMappings validates every provider mapped directly on inj
+// under a name (MapNamed, MapNamedTo, MapNamedProvider), then recurses up
+// the parent chain, mirroring validateOwnMappings. Named bindings live in a
+// map of their own, so without this they're invisible to Validate/
+// ValidateFor: a missing or circular dependency behind one would otherwise
+// only surface as a panic at GetNamed/Apply time.
+func (inj *injector) validateNamedMappings(colors map[validationNode]depColor) error {
+	for key, mv := range inj.namedValues {
+		if colors[validationNode{owner: inj, t: key.t, name: key.name}] != white {
+			continue
+		}
+
+		name := "inject.Injector.Validate"
+		if provider, ok := providerOf(mv); ok {
+			name = funcName(provider)
+		}
+		if err := inj.validateNamedType(key.t, key.name, colors, nil, name); err != nil {
+			return err
+		}
+	}
+
+	if inj.parent != nil {
+		if p, ok := inj.parent.(*injector); ok {
+			return p.validateNamedMappings(colors)
+		}
+	}
+	return nil
+}
+
+// validateOwnMappings validates every provider mapped directly on inj (not
+// through a parent lookup), then recurses up the parent chain so that a
+// cycle confined entirely to a parent's own mappings is still found, even
+// if nothing in inj's own graph references it.
+func (inj *injector) validateOwnMappings(colors map[validationNode]depColor) error {
+	for t, mv := range inj.values {
+		if colors[validationNode{owner: inj, t: t}] != white {
+			continue
+		}
+
+		name := "inject.Injector.Validate"
+		if provider, ok := providerOf(mv); ok {
+			name = funcName(provider)
+		}
+		if err := inj.validateType(t, colors, nil, name); err != nil {
+			return err
+		}
+	}
+
+	if inj.parent != nil {
+		if p, ok := inj.parent.(*injector); ok {
+			return p.validateOwnMappings(colors)
+		}
+	}
+	return nil
+}
+
+// Validate walks every provider mapped on this injector (and its parents),
+// including named bindings (MapNamed, MapNamedTo, MapNamedProvider),
+// reporting the first circular provider chain or unsatisfiable provider
+// argument it finds.
+func (inj *injector) Validate() error {
+	colors := make(map[validationNode]depColor)
+	if err := inj.validateOwnMappings(colors); err != nil {
+		return err
+	}
+	return inj.validateNamedMappings(colors)
+}
+
+// ValidateFor is like Validate, but additionally checks fn's own argument
+// types, as Invoke would resolve them.
+// It panics if fn is not a function.
+func (inj *injector) ValidateFor(fn interface{}) error {
+	t := reflect.TypeOf(fn) // Panics if fn is not kind of Func
+	name := funcName(fn)
+
+	colors := make(map[validationNode]depColor)
+	for i := 0; i < t.NumIn(); i++ {
+		if err := inj.validateType(t.In(i), colors, nil, name); err != nil {
+			return err
+		}
+	}
+	if err := inj.validateOwnMappings(colors); err != nil {
+		return err
+	}
+	return inj.validateNamedMappings(colors)
+}
+
+// Plan resolves fn's argument types once against the current type map (and
+// parent chain) and returns a Plan that can be called repeatedly without
+// repeating that resolution. A context.Context argument that isn't mapped
+// is left unresolved rather than rejected, since Plan.CallContext can
+// supply it on each call.
+// It panics if fn is not a function.
+func (inj *injector) Plan(fn interface{}) (Plan, error) {
+	t := reflect.TypeOf(fn) // Panics if fn is not kind of Func
+
+	slots := make([]planSlot, t.NumIn())
+	for i := range slots {
+		argType := t.In(i)
+		slot := planSlot{argType: argType}
+
+		if mv, ok := inj.resolve(argType); ok {
+			if lv, isLiteral := mv.(literalValue); isLiteral {
+				slot.cached = reflect.Value(lv)
+			} else {
+				slot.dynamic = mv
+			}
+		} else if argType != contextType {
+			return nil, fmt.Errorf("Value not found for type %v", argType)
+		}
+
+		slots[i] = slot
+	}
+
+	return &plan{injector: inj, fn: reflect.ValueOf(fn), slots: slots}, nil
+}
+
+// Call invokes the planned function, returning its return values.
+func (p *plan) Call() ([]reflect.Value, error) {
+	return p.call(nil)
+}
+
+// CallContext is like Call, but supplies ctx directly for any planned
+// argument of type context.Context instead of resolving it from the type map.
+func (p *plan) CallContext(ctx context.Context) ([]reflect.Value, error) {
+	return p.call(ctx)
+}
+
+func (p *plan) call(ctx context.Context) ([]reflect.Value, error) {
+	in := make([]reflect.Value, len(p.slots))
+	for i, slot := range p.slots {
+		switch {
+		case ctx != nil && slot.argType == contextType:
+			in[i] = reflect.ValueOf(ctx)
+		case slot.cached.IsValid():
+			in[i] = slot.cached
+		case slot.dynamic != nil:
+			in[i] = slot.dynamic.Get(p.injector)
+		default:
+			return nil, fmt.Errorf("Value not found for type %v", slot.argType)
+		}
+	}
+
+	return p.fn.Call(in), nil
+}
+
+// wrapKind classifies a chain provider's first argument, if it names the
+// "call the rest of the chain" convention described on Sequence.
+type wrapKind int
+
+const (
+	wrapNone wrapKind = iota
+	wrapPlain
+	wrapError
+)
+
+var (
+	wrapFuncType  = reflect.TypeOf(func() {})
+	wrapErrorType = reflect.TypeOf(func() error { return nil })
+	errorType     = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+func wrapKindOf(t reflect.Type) wrapKind {
+	if t.NumIn() == 0 {
+		return wrapNone
+	}
+	switch t.In(0) {
+	case wrapFuncType:
+		return wrapPlain
+	case wrapErrorType:
+		return wrapError
+	default:
+		return wrapNone
+	}
+}
+
+// neededSatisfiedBy reports whether outType satisfies something in needed:
+// either by an exact match, or, for an interface entry, because outType
+// implements it. This mirrors the interface-implementor fallback Get and
+// resolve already apply, so a chain provider whose concrete output type only
+// satisfies a downstream interface-typed parameter isn't mistaken for unused.
+func neededSatisfiedBy(needed map[reflect.Type]bool, outType reflect.Type) bool {
+	if needed[outType] {
+		return true
+	}
+	for t := range needed {
+		if t.Kind() == reflect.Interface && outType.Implements(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectUsedProviders performs a static backward-reachability analysis over
+// providers: starting from terminal's argument types, it walks the chain in
+// reverse, keeping any provider whose output is needed downstream, plus
+// every wrapper (which always runs for its control-flow side effect
+// regardless of whether anything consumes its return values), and
+// accumulating each kept provider's own argument types into what's needed
+// further upstream.
+func selectUsedProviders(providers []interface{}, terminal reflect.Type) []interface{} {
+	needed := make(map[reflect.Type]bool, terminal.NumIn())
+	for i := 0; i < terminal.NumIn(); i++ {
+		needed[terminal.In(i)] = true
+	}
+
+	keep := make([]bool, len(providers))
+	for i := len(providers) - 1; i >= 0; i-- {
+		pt := reflect.TypeOf(providers[i])
+		kind := wrapKindOf(pt)
+
+		used := kind != wrapNone
+		for o := 0; !used && o < pt.NumOut(); o++ {
+			used = neededSatisfiedBy(needed, pt.Out(o))
+		}
+		if !used {
+			continue
+		}
+		keep[i] = true
+
+		argStart := 0
+		if kind != wrapNone {
+			argStart = 1
+		}
+		for a := argStart; a < pt.NumIn(); a++ {
+			needed[pt.In(a)] = true
+		}
+	}
+
+	used := make([]interface{}, 0, len(providers))
+	for i, k := range keep {
+		if k {
+			used = append(used, providers[i])
+		}
+	}
+	return used
+}
+
+// resolveArg resolves argType from available, falling back to the injector's
+// type map (and its parents). Like Get, an interface argType that isn't an
+// exact key in available may still be satisfied by a concrete chain output
+// that implements it.
+func (inj *injector) resolveArg(argType reflect.Type, available map[reflect.Type]reflect.Value) (reflect.Value, error) {
+	if v, ok := available[argType]; ok {
+		return v, nil
+	}
+	if argType.Kind() == reflect.Interface {
+		for t, v := range available {
+			if t.Implements(argType) {
+				return v, nil
+			}
+		}
+	}
+	v := inj.Get(argType)
+	if !v.IsValid() {
+		return reflect.Value{}, fmt.Errorf("Value not found for type %v", argType)
+	}
+	return v, nil
+}
+
+// callWithAvailable calls fn, resolving each argument from available first
+// and the injector's type map otherwise.
+func (inj *injector) callWithAvailable(fn interface{}, fnType reflect.Type, available map[reflect.Type]reflect.Value) ([]reflect.Value, error) {
+	args := make([]reflect.Value, fnType.NumIn())
+	for i := 0; i < fnType.NumIn(); i++ {
+		v, err := inj.resolveArg(fnType.In(i), available)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return reflect.ValueOf(fn).Call(args), nil
+}
+
+// firstError returns the first non-nil error-typed value among out, if any.
+// It's used to find a chain layer's own failure among its return values,
+// whether that layer is a wrapper or the terminal function itself.
+func firstError(out []reflect.Value) error {
+	for _, v := range out {
+		if v.Type() == errorType && !v.IsNil() {
+			return v.Interface().(error)
+		}
+	}
+	return nil
+}
+
+// nextFunc builds the "call the rest of the chain" function passed as a
+// wrapper provider's first argument. A func()-style next panics if the rest
+// of the chain fails, mirroring the panic-on-failure convention
+// TypeMapper.MapProvider documents for providers; a func() error-style next
+// returns the failure instead.
+func nextFunc(kind wrapKind, rest func() error) reflect.Value {
+	if kind == wrapError {
+		return reflect.ValueOf(func() error { return rest() })
+	}
+	return reflect.ValueOf(func() {
+		if err := rest(); err != nil {
+			panic(err)
+		}
+	})
+}
+
+// InvokeChain runs chain's used providers in order and finally terminal, as
+// described on Sequence.
+// It panics if terminal, or any provider in chain, is not a function.
+func (inj *injector) InvokeChain(chain Chain, terminal interface{}) ([]reflect.Value, error) {
+	terminalType := reflect.TypeOf(terminal) // Panics if terminal is not kind of Func
+
+	used := selectUsedProviders(chain.providers, terminalType)
+
+	var results []reflect.Value
+	var run func(i int, available map[reflect.Type]reflect.Value) error
+	run = func(i int, available map[reflect.Type]reflect.Value) error {
+		if i == len(used) {
+			out, err := inj.callWithAvailable(terminal, terminalType, available)
+			if err != nil {
+				return err
+			}
+			results = out
+			// An error-typed terminal return is the chain's own failure, and
+			// must flow back out through next() to any wrapper watching for
+			// it (e.g. a transaction wrapper deciding whether to commit).
+			return firstError(out)
+		}
+
+		p := used[i]
+		pt := reflect.TypeOf(p) // Panics if p is not kind of Func
+		kind := wrapKindOf(pt)
+
+		args := make([]reflect.Value, pt.NumIn())
+		argStart := 0
+		if kind != wrapNone {
+			argStart = 1
+			args[0] = nextFunc(kind, func() error { return run(i+1, available) })
+		}
+		for a := argStart; a < pt.NumIn(); a++ {
+			v, err := inj.resolveArg(pt.In(a), available)
+			if err != nil {
+				return err
+			}
+			args[a] = v
+		}
+
+		out := reflect.ValueOf(p).Call(args)
+		if kind != wrapNone {
+			// The wrapper has already run the rest of the chain via next();
+			// its own return values have no downstream consumer left to see
+			// them, except for an error return, which becomes this layer's
+			// failure (e.g. a transaction wrapper failing to commit).
+			return firstError(out)
+		}
+
+		next := make(map[reflect.Type]reflect.Value, len(available)+pt.NumOut())
+		for t, v := range available {
+			next[t] = v
+		}
+		for o := 0; o < pt.NumOut(); o++ {
+			next[pt.Out(o)] = out[o]
+		}
+		return run(i+1, next)
+	}
+
+	err := run(0, make(map[reflect.Type]reflect.Value))
+	return results, err
+}
+
 // Maps dependencies in the Type map to each field in the struct
 // that is tagged with 'inject'.
 // Returns an error if the injection fails.
@@ -177,16 +993,41 @@ func (inj *injector) Apply(val interface{}) error {
 	for i := 0; i < v.NumField(); i++ {
 		f := v.Field(i)
 		structField := t.Field(i)
-		if f.CanSet() && (structField.Tag == "inject" || structField.Tag.Get("inject") != "") {
-			ft := f.Type()
-			v := inj.Get(ft)
-			if !v.IsValid() {
-				return fmt.Errorf("Value not found for type %v", ft)
-			}
+		name, tagged := structField.Tag.Lookup("inject")
+		if !f.CanSet() || !(tagged || structField.Tag == "inject") {
+			continue
+		}
 
-			f.Set(v)
+		ft := f.Type()
+		// The tag value names the binding to use (see MapNamed); an untagged
+		// or empty-valued tag falls back to the plain type map.
+		var fv reflect.Value
+		if name != "" {
+			fv = inj.GetNamed(name, ft)
+		} else {
+			fv = inj.Get(ft)
+		}
+		if !fv.IsValid() {
+			return fmt.Errorf("Value not found for type %v", ft)
 		}
 
+		f.Set(fv)
+
+		// A MapSingleton-backed value already ran Initialize, once, under
+		// singletonGroup.ensure when it was first constructed; only
+		// literal and plain-provider values need Apply to run it here.
+		alreadyInitialized := false
+		if mv, ok := inj.lookupMapped(name, ft); ok {
+			_, alreadyInitialized = mv.(singletonValue)
+		}
+
+		if !alreadyInitialized && fv.CanInterface() {
+			if init, ok := fv.Interface().(Initializer); ok {
+				if err := init.Initialize(inj); err != nil {
+					return err
+				}
+			}
+		}
 	}
 
 	return nil
@@ -215,6 +1056,47 @@ func (inj *injector) MapProvider(provider interface{}) TypeMapper {
 	return inj
 }
 
+// MapSingleton maps provider like MapProvider, except its outputs are
+// memoized the first time any of them is requested from this injector,
+// rather than being recomputed on every call.
+func (inj *injector) MapSingleton(provider interface{}) TypeMapper {
+	t := reflect.TypeOf(provider)
+	group := &singletonGroup{owner: inj, provider: provider}
+
+	// t.NumOut panics if t is not of Kind “Func”.
+	for i := 0; i < t.NumOut(); i++ {
+		inj.values[t.Out(i)] = singletonValue{group, i}
+	}
+
+	return inj
+}
+
+// Maps the concrete value of val to its dynamic type using reflect.TypeOf,
+// qualified by name, so it does not collide with a value mapped by Map or
+// with values mapped under other names. It returns the TypeMapper registered in.
+func (i *injector) MapNamed(name string, val interface{}) TypeMapper {
+	i.namedValues[namedKey{reflect.TypeOf(val), name}] = literalValue(reflect.ValueOf(val))
+	return i
+}
+
+// MapNamedTo is the named equivalent of MapTo: see MapNamed.
+func (i *injector) MapNamedTo(name string, val interface{}, ifacePtr interface{}) TypeMapper {
+	i.namedValues[namedKey{InterfaceOf(ifacePtr), name}] = literalValue(reflect.ValueOf(val))
+	return i
+}
+
+// MapNamedProvider is the named equivalent of MapProvider: see MapNamed.
+func (inj *injector) MapNamedProvider(name string, provider interface{}) TypeMapper {
+	t := reflect.TypeOf(provider)
+
+	// t.NumOut panics if t is not of Kind “Func”.
+	for i := 0; i < t.NumOut(); i++ {
+		inj.namedValues[namedKey{t.Out(i), name}] = providedValue{provider, i}
+	}
+
+	return inj
+}
+
 // Maps the given reflect.Type to the given reflect.Value and returns
 // the Typemapper the mapping has been registered in.
 func (i *injector) Set(typ reflect.Type, val reflect.Value) TypeMapper {
@@ -299,6 +1181,59 @@ func (i *injector) Get(t reflect.Type, options ...interface{}) reflect.Value {
 	return reflect.Value{}
 }
 
+// GetNamed looks up a value mapped under both t and name (via MapNamed,
+// MapNamedTo, or MapNamedProvider). It never falls back to a value mapped
+// without a name: callers that want that behaviour should call Get instead.
+func (i *injector) GetNamed(name string, t reflect.Type, options ...interface{}) reflect.Value {
+	config := &getConfig{
+		youngestInjector: i,
+	}
+	for _, option := range options {
+		switch option := option.(type) {
+		case getOptionsFunc:
+			option(config)
+		default:
+			panic(fmt.Errorf("unrecognized Get option: %v", option))
+		}
+	}
+
+	key := namedKey{t, name}
+	if val, ok := i.namedValues[key]; ok {
+		return val.Get(config.youngestInjector)
+	}
+
+	// no concrete types found, try to find implementors
+	// if t is an interface
+	if t.Kind() == reflect.Interface {
+		for k, v := range i.namedValues {
+			if k.name == name && k.t.Implements(t) {
+				return v.Get(config.youngestInjector)
+			}
+		}
+	}
+
+	// Still no type found, try to look it up on the parent
+	if i.parent != nil {
+		return i.parent.GetNamed(name, t, withYoungestInjector(config.youngestInjector))
+	}
+
+	return reflect.Value{}
+}
+
 func (i *injector) SetParent(parent Injector) {
 	i.parent = parent
 }
+
+// Dispose calls Dispose, in LIFO order, on every Disposer value this
+// injector constructed via MapSingleton. It does not touch values inherited
+// from a parent injector: call Dispose on the parent separately if needed.
+func (i *injector) Dispose() {
+	i.disposersMu.Lock()
+	disposers := i.disposers
+	i.disposers = nil
+	i.disposersMu.Unlock()
+
+	for idx := len(disposers) - 1; idx >= 0; idx-- {
+		disposers[idx].Dispose()
+	}
+}
@@ -0,0 +1,437 @@
+package inject
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestMapNamedAndGetNamed(t *testing.T) {
+	inj := New()
+	inj.MapNamed("primary", "p")
+	inj.MapNamed("replica", "r")
+
+	strType := reflect.TypeOf("")
+	if v := inj.GetNamed("primary", strType); v.String() != "p" {
+		t.Fatalf("got %v", v)
+	}
+	if v := inj.GetNamed("replica", strType); v.String() != "r" {
+		t.Fatalf("got %v", v)
+	}
+	// A plain Get must not see a value mapped only under a name.
+	if v := inj.Get(strType); v.IsValid() {
+		t.Fatalf("expected no unnamed string mapping, got %v", v)
+	}
+}
+
+func TestApplyHonorsInjectTagAsBindingName(t *testing.T) {
+	inj := New()
+	inj.MapNamed("primaryDB", "primary-conn")
+	inj.MapNamed("replicaDB", "replica-conn")
+	inj.Map("untagged")
+
+	type config struct {
+		Primary  string `inject:"primaryDB"`
+		Replica  string `inject:"replicaDB"`
+		Untagged string `inject:""`
+	}
+
+	c := &config{}
+	if err := inj.Apply(c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Primary != "primary-conn" || c.Replica != "replica-conn" {
+		t.Fatalf("got %+v", c)
+	}
+	if c.Untagged != "untagged" {
+		t.Fatalf("expected untagged field to fall back to the plain type map, got %q", c.Untagged)
+	}
+}
+
+func TestMapNamedProvider(t *testing.T) {
+	inj := New()
+	calls := 0
+	inj.MapNamedProvider("greeting", func() string {
+		calls++
+		return "hi"
+	})
+
+	v := inj.GetNamed("greeting", reflect.TypeOf(""))
+	if v.String() != "hi" {
+		t.Fatalf("got %v", v)
+	}
+	inj.GetNamed("greeting", reflect.TypeOf(""))
+	if calls != 2 {
+		t.Fatalf("expected a plain named provider to run on every Get, got %d calls", calls)
+	}
+}
+
+func TestPlanCachesLiteralsReevaluatesProviders(t *testing.T) {
+	inj := New()
+	inj.Map(42)
+	calls := 0
+	inj.MapProvider(func() string {
+		calls++
+		return "s"
+	})
+
+	p, err := inj.Plan(func(n int, s string) int { return n })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		out, err := p.Call()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out[0].Int() != 42 {
+			t.Fatalf("got %v", out)
+		}
+	}
+	if calls != 3 {
+		t.Fatalf("expected the provider-backed slot to be re-evaluated on every call, got %d calls", calls)
+	}
+}
+
+func TestPlanCallContextSuppliesContext(t *testing.T) {
+	inj := New()
+
+	p, err := inj.Plan(func(ctx context.Context) int {
+		if ctx.Value("k") == "v" {
+			return 7
+		}
+		return 0
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.WithValue(context.Background(), "k", "v")
+	out, err := p.CallContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out[0].Int() != 7 {
+		t.Fatalf("got %v", out)
+	}
+}
+
+func TestPlanErrorsOnUnsatisfiableArgument(t *testing.T) {
+	inj := New()
+	if _, err := inj.Plan(func(s string) {}); err == nil {
+		t.Fatal("expected Plan to fail for an unmapped argument type")
+	}
+}
+
+func TestInvokeChainSkipsUnusedProviders(t *testing.T) {
+	inj := New()
+
+	unusedCalled := false
+	unused := func() float64 {
+		unusedCalled = true
+		return 1.0
+	}
+
+	var order []string
+	provideInt := func() int {
+		order = append(order, "provideInt")
+		return 5
+	}
+	wrapLog := func(next func(), n int) {
+		order = append(order, "before")
+		next()
+		order = append(order, "after")
+	}
+
+	chain := Sequence(unused, provideInt, wrapLog)
+	terminal := func(n int) string {
+		order = append(order, "terminal")
+		return "done"
+	}
+
+	out, err := inj.InvokeChain(chain, terminal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out[0].String() != "done" {
+		t.Fatalf("got %v", out)
+	}
+	if unusedCalled {
+		t.Fatal("expected unused provider to be skipped")
+	}
+
+	want := []string{"provideInt", "before", "terminal", "after"}
+	if len(order) != len(want) {
+		t.Fatalf("got order %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("got order %v, want %v", order, want)
+		}
+	}
+}
+
+func TestInvokeChainPropagatesTerminalError(t *testing.T) {
+	inj := New()
+
+	var committed, rolledBack bool
+	txWrap := func(next func() error) error {
+		if err := next(); err != nil {
+			rolledBack = true
+			return err
+		}
+		committed = true
+		return nil
+	}
+
+	wantErr := errors.New("handler failed")
+	terminal := func() error { return wantErr }
+
+	_, err := inj.InvokeChain(Sequence(txWrap), terminal)
+	if err != wantErr {
+		t.Fatalf("got err %v, want %v", err, wantErr)
+	}
+	if committed {
+		t.Fatal("expected wrapper not to commit on terminal failure")
+	}
+	if !rolledBack {
+		t.Fatal("expected wrapper to see the terminal's failure and roll back")
+	}
+}
+
+func TestInvokeChainWrapErrorPropagation(t *testing.T) {
+	inj := New()
+
+	wantErr := errors.New("commit failed")
+	errWrap := func(next func() error) error {
+		if err := next(); err != nil {
+			return err
+		}
+		return wantErr
+	}
+
+	_, err := inj.InvokeChain(Sequence(errWrap), func() {})
+	if err != wantErr {
+		t.Fatalf("got %v, want %v", err, wantErr)
+	}
+}
+
+type lifecycleResource struct {
+	initCount int
+	disposed  bool
+}
+
+func (r *lifecycleResource) Initialize(Injector) error {
+	r.initCount++
+	return nil
+}
+
+func (r *lifecycleResource) Dispose() {
+	r.disposed = true
+}
+
+func TestMapSingletonMemoizesAndInitializesOnce(t *testing.T) {
+	inj := New()
+	calls := 0
+	inj.MapSingleton(func() *lifecycleResource {
+		calls++
+		return &lifecycleResource{}
+	})
+
+	results, err := inj.Invoke(func(r *lifecycleResource) *lifecycleResource { return r })
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := results[0].Interface().(*lifecycleResource)
+
+	if _, err := inj.Invoke(func(*lifecycleResource) {}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected provider called once, got %d", calls)
+	}
+	if r.initCount != 1 {
+		t.Fatalf("expected Initialize called once, got %d", r.initCount)
+	}
+}
+
+func TestApplyDoesNotReinitializeSingleton(t *testing.T) {
+	inj := New()
+	inj.MapSingleton(func() *lifecycleResource { return &lifecycleResource{} })
+
+	type S struct {
+		R *lifecycleResource `inject:""`
+	}
+
+	// Force construction (and Initialize) via Invoke before Apply sees it.
+	if _, err := inj.Invoke(func(*lifecycleResource) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &S{}
+	if err := inj.Apply(s); err != nil {
+		t.Fatal(err)
+	}
+	if s.R.initCount != 1 {
+		t.Fatalf("expected Initialize to run exactly once, got %d", s.R.initCount)
+	}
+}
+
+func TestDisposeOnlyOwnValues(t *testing.T) {
+	parent := New()
+	parentResource := &lifecycleResource{}
+	parent.MapSingleton(func() *lifecycleResource { return parentResource })
+	if _, err := parent.Invoke(func(*lifecycleResource) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	child := New()
+	child.SetParent(parent)
+
+	// child never mapped its own *lifecycleResource, so it only ever sees
+	// the parent's instance through the parent chain.
+	if _, err := child.Invoke(func(*lifecycleResource) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	child.Dispose()
+	if parentResource.disposed {
+		t.Fatal("child.Dispose must not dispose a value it did not construct")
+	}
+
+	parent.Dispose()
+	if !parentResource.disposed {
+		t.Fatal("expected parent.Dispose to dispose its own singleton")
+	}
+}
+
+func TestValidateForDetectsMissingDependency(t *testing.T) {
+	inj := New()
+	inj.Map(5)
+
+	if err := inj.ValidateFor(func(n int) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := inj.ValidateFor(func(s string) {})
+	de, ok := err.(*DependencyError)
+	if !ok || de.Missing != reflect.TypeOf("") {
+		t.Fatalf("got %#v, want a DependencyError with Missing set to string", err)
+	}
+}
+
+type validateA struct{}
+type validateB struct{}
+
+func TestValidateDetectsCycle(t *testing.T) {
+	inj := New()
+	inj.MapProvider(func(validateB) validateA { return validateA{} })
+	inj.MapProvider(func(validateA) validateB { return validateB{} })
+
+	err := inj.Validate()
+	de, ok := err.(*DependencyError)
+	if !ok || de.Cycle == nil {
+		t.Fatalf("got %#v, want a DependencyError with Cycle set", err)
+	}
+}
+
+func TestValidateWalksParentsOwnMappings(t *testing.T) {
+	parent := New()
+	parent.MapProvider(func(validateB) validateA { return validateA{} })
+	parent.MapProvider(func(validateA) validateB { return validateB{} })
+
+	// child's own mappings are acyclic and never reference validateA/validateB,
+	// so the cycle is only reachable by walking the parent's own graph.
+	child := New()
+	child.SetParent(parent)
+	child.Map(5)
+
+	err := child.Validate()
+	de, ok := err.(*DependencyError)
+	if !ok || de.Cycle == nil {
+		t.Fatalf("got %#v, want child.Validate to surface the parent's cycle", err)
+	}
+}
+
+func TestMapSingletonConcurrentGroupsDoNotRaceOnDisposers(t *testing.T) {
+	owner := New().(*injector)
+
+	// Many distinct singletonGroups owned by the same injector, each gated
+	// on the same barrier so their first-use constructions (and the
+	// resulting disposers appends) are forced to overlap. This exercises
+	// singletonGroup.ensure directly: its own sync.Once only serializes a
+	// single group, never the owner.disposers slice shared across groups.
+	// Run under `go test -race`.
+	const groups = 500
+	var start sync.WaitGroup
+	start.Add(1)
+	pending := make([]*singletonGroup, groups)
+	for idx := range pending {
+		pending[idx] = &singletonGroup{
+			owner: owner,
+			provider: func() *lifecycleResource {
+				start.Wait()
+				return &lifecycleResource{}
+			},
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(groups)
+	for _, g := range pending {
+		g := g
+		go func() {
+			defer wg.Done()
+			g.ensure(owner)
+		}()
+	}
+	start.Done() // release every provider at once, forcing the disposers appends to overlap
+	wg.Wait()
+
+	if len(owner.disposers) != groups {
+		t.Fatalf("got %d disposers, want %d", len(owner.disposers), groups)
+	}
+	owner.Dispose()
+}
+
+func TestInvokeChainProviderSatisfiesDownstreamInterfaceArg(t *testing.T) {
+	inj := New()
+
+	var buf bytes.Buffer
+	provideBuf := func() *bytes.Buffer { return &buf }
+
+	chain := Sequence(provideBuf)
+	terminal := func(w io.Writer) string {
+		w.Write([]byte("hi"))
+		return "done"
+	}
+
+	out, err := inj.InvokeChain(chain, terminal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out[0].String() != "done" {
+		t.Fatalf("got %v", out)
+	}
+	if buf.String() != "hi" {
+		t.Fatalf("expected the concrete *bytes.Buffer provider to satisfy the io.Writer terminal argument, got %q", buf.String())
+	}
+}
+
+func TestValidateDetectsMissingDependencyBehindNamedProvider(t *testing.T) {
+	inj := New()
+	// validateB is never mapped anywhere, and nothing in the plain type map
+	// references this named provider, so the only way to reach the problem
+	// is by walking inj.namedValues directly.
+	inj.MapNamedProvider("a", func(validateB) validateA { return validateA{} })
+
+	err := inj.Validate()
+	de, ok := err.(*DependencyError)
+	if !ok || de.Missing != reflect.TypeOf(validateB{}) {
+		t.Fatalf("got %#v, want a DependencyError with Missing set to validateB", err)
+	}
+}